@@ -2,31 +2,197 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"strings"
 
 	regex "github.com/maartenJacobs/go-grep/regex"
 )
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: go-grep expr")
-		os.Exit(2)
+	os.Exit(run(os.Args[1:]))
+}
+
+// run implements the go-grep command line and returns a process exit code following
+// grep conventions: 0 if some line matched, 1 if none did, 2 on a usage or I/O error.
+func run(args []string) int {
+	flags := flag.NewFlagSet("go-grep", flag.ContinueOnError)
+	lineNumbers := flags.Bool("n", false, "print line numbers")
+	invert := flags.Bool("v", false, "print non-matching lines")
+	count := flags.Bool("c", false, "print only a count of matching lines")
+	ignoreCase := flags.Bool("i", false, "ignore case")
+	onlyMatch := flags.Bool("o", false, "print only the matched part of the line")
+	recursive := flags.Bool("r", false, "recursively search directories")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: go-grep [-nvcior] PATTERN [FILE...]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return 2
 	}
 
-	stdin := bufio.NewReader(os.Stdin)
-	line, err := stdin.ReadString('\n')
+	automata, err := regex.Compile(bufio.NewReader(strings.NewReader(flags.Arg(0))))
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(2)
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if *ignoreCase {
+		automata.IgnoreCase()
 	}
 
-	automata, err := regex.Compile(bufio.NewReader(strings.NewReader(os.Args[1])))
+	paths := flags.Args()[1:]
+	files, err := expandPaths(paths, *recursive)
 	if err != nil {
-		fmt.Println(err)
-	} else {
-		input := strings.TrimRight(line, "\n")
-		fmt.Printf("Trying '%s' on '%s': %v\n", os.Args[1], input, automata.Matches(input))
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	opts := searchOptions{
+		lineNumbers: *lineNumbers,
+		invert:      *invert,
+		count:       *count,
+		onlyMatch:   *onlyMatch,
+		showName:    len(files) > 1,
+	}
+
+	matched := false
+	hadError := false
+	if len(files) == 0 {
+		lineMatched, err := search(os.Stdin, "", automata, opts, os.Stdout)
+		matched = matched || lineMatched
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			hadError = true
+		}
+	}
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			hadError = true
+			continue
+		}
+		lineMatched, err := search(f, name, automata, opts, os.Stdout)
+		f.Close()
+		matched = matched || lineMatched
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			hadError = true
+		}
+	}
+
+	switch {
+	case hadError:
+		return 2
+	case matched:
+		return 0
+	default:
+		return 1
+	}
+}
+
+// expandPaths turns the file and directory operands given on the command line into a
+// flat list of regular files to search, walking any directory with filepath.WalkDir
+// when recursive is set, and rejecting directories otherwise.
+func expandPaths(paths []string, recursive bool) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		if !recursive {
+			return nil, fmt.Errorf("go-grep: %s: is a directory", path)
+		}
+		err = filepath.WalkDir(path, func(walked string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !entry.IsDir() {
+				files = append(files, walked)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// searchOptions controls how search reports the lines it reads, mirroring the
+// corresponding grep flags.
+type searchOptions struct {
+	lineNumbers bool
+	invert      bool
+	count       bool
+	onlyMatch   bool
+	showName    bool
+}
+
+// search streams in line by line, printing the lines selected by opts (matching lines,
+// or with opts.invert, non-matching ones) to out, and reports whether any line matched
+// the pattern, regardless of opts.invert.
+func search(in io.Reader, name string, automata *regex.Automata, opts searchOptions, out io.Writer) (bool, error) {
+	scanner := bufio.NewScanner(in)
+	lineNum := 0
+	matchCount := 0
+	anyMatch := false
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		_, _, ok := automata.Find(line)
+		if ok {
+			anyMatch = true
+		}
+
+		show := ok
+		if opts.invert {
+			show = !ok
+		}
+		if !show {
+			continue
+		}
+		matchCount++
+		if opts.count {
+			continue
+		}
+
+		prefix := ""
+		if opts.showName {
+			prefix += name + ":"
+		}
+		if opts.lineNumbers {
+			prefix += fmt.Sprintf("%d:", lineNum)
+		}
+
+		if opts.onlyMatch && !opts.invert {
+			runes := []rune(line)
+			for _, span := range automata.FindAll(line) {
+				fmt.Fprintf(out, "%s%s\n", prefix, string(runes[span[0]:span[1]]))
+			}
+			continue
+		}
+		fmt.Fprintf(out, "%s%s\n", prefix, line)
+	}
+	if opts.count {
+		prefix := ""
+		if opts.showName {
+			prefix = name + ":"
+		}
+		fmt.Fprintf(out, "%s%d\n", prefix, matchCount)
 	}
+	return anyMatch, scanner.Err()
 }
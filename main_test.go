@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	regex "github.com/maartenJacobs/go-grep/regex"
+)
+
+// TestSearchOnlyMatchAllOccurrences checks that -o prints every match on a line, not just
+// the first: `grep -o` prints one output line per match, the same as POSIX/GNU grep.
+func TestSearchOnlyMatchAllOccurrences(t *testing.T) {
+	automata, err := regex.Compile(bufio.NewReader(strings.NewReader("X")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	matched, err := search(strings.NewReader("aXbXXc"), "", automata, searchOptions{onlyMatch: true}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !matched {
+		t.Error("expected a match")
+	}
+	want := "X\nX\nX\n"
+	if out.String() != want {
+		t.Errorf("search output = %q, want %q", out.String(), want)
+	}
+}
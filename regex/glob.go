@@ -0,0 +1,99 @@
+package regex
+
+import (
+	"bufio"
+	"errors"
+	"strings"
+)
+
+// Errors returned by CompileGlob when the glob syntax is invalid.
+var (
+	// ErrGlobUnmatchedLbkt is returned when a '[' is never closed by a matching ']'.
+	ErrGlobUnmatchedLbkt = errors.New("regex: unmatched '[' in glob")
+	// ErrGlobBadRange is returned when a character class range such as [a-z] is
+	// malformed, e.g. missing an endpoint or running from a higher to a lower rune.
+	ErrGlobBadRange = errors.New("regex: bad character range in glob class")
+	// ErrGlobExtraneousBackslash is returned when '\\' appears with no following rune to
+	// escape.
+	ErrGlobExtraneousBackslash = errors.New("regex: '\\' at end of glob")
+)
+
+// compileGlobClass parses the body of a glob character class, e.g. `abc]` or `!a-z]`,
+// having already consumed the opening '['. It shares compileClassBody with compileClass,
+// but negates with a leading '!' rather than '^', matching shell/IRC glob convention, and
+// reports glob's own error variants.
+func compileGlobClass(input *bufio.Reader) (*classSet, error) {
+	escape := func(input *bufio.Reader) (rune, error) {
+		c, _, err := input.ReadRune()
+		if err != nil {
+			return 0, ErrGlobExtraneousBackslash
+		}
+		return c, nil
+	}
+	return compileClassBody(input, '!', escape, ErrGlobUnmatchedLbkt, ErrGlobBadRange)
+}
+
+// compileGlobExpression parses a glob pattern into an expr tree: `*` becomes
+// kleene{anyChar{}} (any run of runes), `?` becomes anyChar{} (any single rune), `[...]`
+// and `[!...]` become character classes, and `\` escapes the following rune to match it
+// literally. Every other rune matches itself. Unlike compileExpression, globs have no
+// grouping or alternation, so the result is a flat concatenation.
+func compileGlobExpression(input *bufio.Reader) (expr, error) {
+	var exprs []expr
+	for {
+		c, _, err := input.ReadRune()
+		if err != nil {
+			break
+		}
+		switch c {
+		case '*':
+			exprs = append(exprs, kleene{expr: anyChar{}})
+
+		case '?':
+			exprs = append(exprs, anyChar{})
+
+		case '[':
+			set, err := compileGlobClass(input)
+			if err != nil {
+				return nil, err
+			}
+			exprs = append(exprs, class{set: set})
+
+		case '\\':
+			escaped, _, err := input.ReadRune()
+			if err != nil {
+				return nil, ErrGlobExtraneousBackslash
+			}
+			exprs = append(exprs, match{c: escaped})
+
+		default:
+			exprs = append(exprs, match{c: c})
+		}
+	}
+	if len(exprs) == 0 {
+		return emptyMatch{}, nil
+	}
+	return concat{exprs: exprs}, nil
+}
+
+// CompileGlob parses pattern as a shell/IRC-style glob and returns the equivalent
+// Automata. `*` matches any run of runes, `?` matches any single rune, `[abc]`, `[a-z]`
+// and `[!abc]` are character classes, and `\` escapes a metacharacter to match it
+// literally. It lowers the glob into the same expr tree Compile uses, so callers like
+// chat servers, config systems or file-mask filters get Determinize and FindAll for free
+// instead of needing a second matching engine.
+//
+// If anchored is false, pattern is wrapped in `.*` on both ends, so it matches anywhere
+// in the input rather than requiring the whole input to match -- the usual mode for
+// hostname or nickmask matching, e.g. `*!*@*.example.com`.
+func CompileGlob(pattern string, anchored bool) (*Automata, error) {
+	parsed, err := compileGlobExpression(bufio.NewReader(strings.NewReader(pattern)))
+	if err != nil {
+		return nil, err
+	}
+	if !anchored {
+		parsed = concat{exprs: []expr{kleene{expr: anyChar{}}, parsed, kleene{expr: anyChar{}}}}
+	}
+	automata := parsed.convert()
+	return &automata, nil
+}
@@ -0,0 +1,74 @@
+package regex
+
+import "testing"
+
+func compileGlob(t *testing.T, pattern string, anchored bool) *Automata {
+	t.Helper()
+	automata, err := CompileGlob(pattern, anchored)
+	if err != nil {
+		t.Fatalf("CompileGlob(%q, %v): %v", pattern, anchored, err)
+	}
+	return automata
+}
+
+// TestCompileGlobAnchored checks glob matching against the whole input: `*`, `?` and
+// classes, including negation and escapes.
+func TestCompileGlobAnchored(t *testing.T) {
+	cases := []struct {
+		pattern string
+		in      string
+		want    bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "main.c", false},
+		{"file?.txt", "file1.txt", true},
+		{"file?.txt", "file12.txt", false},
+		{"[a-c]at", "bat", true},
+		{"[a-c]at", "zat", false},
+		{"[!a-c]at", "zat", true},
+		{"[!a-c]at", "bat", false},
+		{`\*.go`, "*.go", true},
+		{`\*.go`, "x.go", false},
+	}
+	for _, c := range cases {
+		automata := compileGlob(t, c.pattern, true)
+		if got := automata.Matches(c.in); got != c.want {
+			t.Errorf("CompileGlob(%q, true).Matches(%q) = %v, want %v", c.pattern, c.in, got, c.want)
+		}
+	}
+}
+
+// TestCompileGlobUnanchored checks that an unanchored glob, the mode used for hostname and
+// nickmask matching, matches anywhere in the input rather than requiring the whole input
+// to match.
+func TestCompileGlobUnanchored(t *testing.T) {
+	automata := compileGlob(t, "*!*@*.example.com", false)
+	if !automata.Matches("nick!user@host.example.com") {
+		t.Error("expected unanchored glob to match")
+	}
+	if automata.Matches("nick!user@host.example.org") {
+		t.Error("expected unanchored glob not to match a different domain")
+	}
+
+	anchored := compileGlob(t, "foo", true)
+	if anchored.Matches("xfoox") {
+		t.Error("expected anchored glob not to match substrings")
+	}
+}
+
+// TestCompileGlobErrors checks that malformed glob syntax is reported as a returned error.
+func TestCompileGlobErrors(t *testing.T) {
+	cases := []struct {
+		pattern string
+		wantErr error
+	}{
+		{"[abc", ErrGlobUnmatchedLbkt},
+		{"[z-a]", ErrGlobBadRange},
+		{`a\`, ErrGlobExtraneousBackslash},
+	}
+	for _, c := range cases {
+		if _, err := CompileGlob(c.pattern, true); err != c.wantErr {
+			t.Errorf("CompileGlob(%q) err = %v, want %v", c.pattern, err, c.wantErr)
+		}
+	}
+}
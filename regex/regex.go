@@ -6,12 +6,32 @@ import (
 	"fmt"
 	"io"
 	"sort"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 	"unsafe"
 )
 
 const empty rune = 0
 
+// Errors returned by Compile when the regular expression syntax is invalid.
+var (
+	// ErrUnmatchedLbkt is returned when a '[' is never closed by a matching ']'.
+	ErrUnmatchedLbkt = errors.New("regex: unmatched '['")
+	// ErrBadRange is returned when a character class range such as [a-z] is malformed,
+	// e.g. missing an endpoint or running from a higher to a lower rune.
+	ErrBadRange = errors.New("regex: bad character range in class")
+	// ErrBareClosure is returned when '*', '+' or '?' appears with no preceding expression.
+	ErrBareClosure = errors.New("regex: closure operator has nothing to repeat")
+	// ErrExtraneousBackslash is returned when '\\' appears with no following rune to escape.
+	ErrExtraneousBackslash = errors.New("regex: '\\' at end of expression")
+	// ErrEmptyExpr is returned when part of the expression that must describe something -
+	// the whole pattern, a group's contents, or one side of a '|' - is empty, e.g. "|a",
+	// "()" or "a(b|)c".
+	ErrEmptyExpr = errors.New("regex: empty expression")
+)
+
 type state uint8
 
 func newState() *state {
@@ -19,21 +39,141 @@ func newState() *state {
 	return &state
 }
 
+// classSet describes the runes accepted by a character class such as [a-z] or [^abc].
+type classSet struct {
+	runes  map[rune]bool
+	ranges []runeRange
+	negate bool
+}
+
+type runeRange struct {
+	lo, hi rune
+}
+
+func (cs *classSet) matches(c rune) bool {
+	in := cs.runes[c]
+	if !in {
+		for _, r := range cs.ranges {
+			if c >= r.lo && c <= r.hi {
+				in = true
+				break
+			}
+		}
+	}
+	if cs.negate {
+		return !in
+	}
+	return in
+}
+
+// classEdge is the single NFA transition produced for a character class: from a state,
+// any rune accepted by set moves to target.
+type classEdge struct {
+	set    *classSet
+	target *state
+}
+
+// tagEdge is an epsilon transition that, when crossed, also records the input position
+// as the start or end of a capturing group. It backs the (...) submatch API.
+type tagEdge struct {
+	group  int
+	start  bool
+	target *state
+}
+
 // Automata represents the compiled regular expression. It can be used to test whether
 // the regular expression describes a given string.
 type Automata struct {
-	initial     *state
-	accepting   *state
-	transitions map[*state]map[rune][]*state
+	initial      *state
+	accepting    *state
+	transitions  map[*state]map[rune][]*state
+	classes      map[*state]classEdge
+	startAnchors map[*state][]*state
+	endAnchors   map[*state][]*state
+	tags         map[*state][]tagEdge
+	// numGroups is the number of capturing groups in the expression, not counting
+	// group 0 (the whole match).
+	numGroups int
+	// foldCase, when set by IgnoreCase, makes simulation case-insensitive by trying
+	// each input rune's lower- and upper-case forms against the compiled automaton.
+	foldCase bool
+}
+
+// IgnoreCase makes subsequent Matches, Find, FindAll and FindSubmatch calls on m
+// case-insensitive. Rather than recompiling the expression, it makes the simulation try
+// each input rune's lower- and upper-case forms against the already-compiled automaton.
+func (m *Automata) IgnoreCase() {
+	m.foldCase = true
+}
+
+// caseVariants returns the runes that should be tried against a compiled automaton's
+// classes and transitions when case folding is enabled: c itself, plus its lower- and
+// upper-case forms where those differ from c.
+func caseVariants(c rune) []rune {
+	variants := []rune{c}
+	if lower := unicode.ToLower(c); lower != c {
+		variants = append(variants, lower)
+	}
+	if upper := unicode.ToUpper(c); upper != c {
+		variants = append(variants, upper)
+	}
+	return variants
+}
+
+// groupTags records the input offset at which each capturing group's start and end tag
+// was crossed during a simulation. tags[2*g] is group g's start offset, tags[2*g+1] is
+// its end offset; both are -1 until the corresponding tag has fired. Group 0 is the
+// whole match, added implicitly by Find and friends.
+type groupTags []int
+
+func newGroupTags(numGroups int) groupTags {
+	tags := make(groupTags, 2*(numGroups+1))
+	for i := range tags {
+		tags[i] = -1
+	}
+	return tags
+}
+
+// withTag returns a copy of tags with the group's start or end offset set to pos. It
+// copies rather than mutates because the same tags slice is shared by every NFA thread
+// that branched from a common ancestor.
+func (tags groupTags) withTag(group int, start bool, pos int) groupTags {
+	next := make(groupTags, len(tags))
+	copy(next, tags)
+	if start {
+		next[2*group] = pos
+	} else {
+		next[2*group+1] = pos
+	}
+	return next
 }
 
 func (m *Automata) getTransitions(st *state, c rune) []*state {
 	var trans []*state
 	if c == empty {
 		trans = append(trans, st)
+		if nextStates, hasNext := m.transitions[st][empty]; hasNext {
+			trans = append(trans, nextStates...)
+		}
+		return trans
+	}
+
+	candidates := []rune{c}
+	if m.foldCase {
+		candidates = caseVariants(c)
+	}
+	if edge, hasClass := m.classes[st]; hasClass {
+		for _, rc := range candidates {
+			if edge.set.matches(rc) {
+				trans = append(trans, edge.target)
+				break
+			}
+		}
 	}
-	if nextStates, hasNext := m.transitions[st][c]; hasNext {
-		trans = append(trans, nextStates...)
+	for _, rc := range candidates {
+		if nextStates, hasNext := m.transitions[st][rc]; hasNext {
+			trans = append(trans, nextStates...)
+		}
 	}
 	return trans
 }
@@ -41,21 +181,113 @@ func (m *Automata) getTransitions(st *state, c rune) []*state {
 // Matches takes a string and checks if it can be described by the regular expression,
 // expressed by the automata.
 func (m Automata) Matches(in string) bool {
-	matcher := newMatcher(m)
-	for _, c := range in {
-		matcher.move(c)
+	runes := []rune(in)
+	matcher := newMatcher(m, len(runes) == 0)
+	for i, c := range runes {
+		matcher.move(c, i+1, i == len(runes)-1)
 	}
 	return matcher.isInAcceptingState()
 }
 
+// wrappedForSearch wraps m in the implicit `.*?(expr).*?` that Find, FindAll and
+// FindSubmatch search with: a non-greedy run of any character, then m captured as group
+// 0, then another non-greedy run of any character. Unlike Matches, which requires the
+// whole input to match, this locates the expression anywhere in the input.
+func (m Automata) wrappedForSearch() Automata {
+	group0 := concatAutomata(concatAutomata(
+		tagMark{group: 0, start: true}.convert(),
+		m,
+	), tagMark{group: 0, start: false}.convert())
+	wrapped := concatAutomata(concatAutomata(
+		lazyKleene{expr: anyChar{}}.convert(),
+		group0,
+	), lazyKleene{expr: anyChar{}}.convert())
+	wrapped.numGroups = m.numGroups
+	wrapped.foldCase = m.foldCase
+	return wrapped
+}
+
+// findSubmatches runs the simulation over in using the implicit unanchored wrapper and
+// returns the recorded group boundaries as rune offsets, or nil if the expression does
+// not appear anywhere in in. spans[2*g] and spans[2*g+1] are the start and end offset of
+// group g; group 0 is the whole match.
+func (m Automata) findSubmatches(in string) groupTags {
+	wrapped := m.wrappedForSearch()
+	runes := []rune(in)
+	matcher := newMatcher(wrapped, len(runes) == 0)
+	for i, c := range runes {
+		matcher.move(c, i+1, i == len(runes)-1)
+	}
+	return matcher.acceptingTags()
+}
+
+// Find returns the rune-index span, as a half-open [start, end) range, of the leftmost
+// match of the expression in in. ok is false if the expression does not appear anywhere
+// in in.
+func (m Automata) Find(in string) (start, end int, ok bool) {
+	spans := m.findSubmatches(in)
+	if spans == nil {
+		return 0, 0, false
+	}
+	return spans[0], spans[1], true
+}
+
+// FindAll returns the rune-index spans of all non-overlapping matches of the expression
+// in in, scanning left to right. It returns nil if there is no match.
+func (m Automata) FindAll(in string) [][2]int {
+	runes := []rune(in)
+	var spans [][2]int
+	for offset := 0; offset <= len(runes); {
+		start, end, ok := m.Find(string(runes[offset:]))
+		if !ok {
+			break
+		}
+		spans = append(spans, [2]int{offset + start, offset + end})
+		if end == start {
+			offset += end + 1
+		} else {
+			offset += end
+		}
+	}
+	return spans
+}
+
+// FindSubmatch returns the text of the leftmost match of the expression in in and its
+// capturing groups: index 0 is the whole match, followed by one entry per group in the
+// order their '(' appeared. A group that took no part in the match is "". It returns nil
+// if the expression does not appear anywhere in in.
+func (m Automata) FindSubmatch(in string) []string {
+	spans := m.findSubmatches(in)
+	if spans == nil {
+		return nil
+	}
+	runes := []rune(in)
+	result := make([]string, m.numGroups+1)
+	for g := range result {
+		start, end := spans[2*g], spans[2*g+1]
+		if start < 0 || end < 0 {
+			continue
+		}
+		result[g] = string(runes[start:end])
+	}
+	return result
+}
+
+// thread is a single NFA thread in the simulation: the state it currently occupies and
+// the capturing group boundaries it has recorded on the way there.
+type thread struct {
+	state *state
+	tags  groupTags
+}
+
 type matcher struct {
-	automata  Automata
-	oldStates []*state
-	newStates []*state
-	alreadyOn map[*state]bool
+	automata   Automata
+	oldThreads []thread
+	newThreads []thread
+	alreadyOn  map[*state]bool
 }
 
-func newMatcher(automata Automata) matcher {
+func newMatcher(automata Automata, atEnd bool) matcher {
 	matcher := matcher{
 		automata:  automata,
 		alreadyOn: make(map[*state]bool),
@@ -66,51 +298,120 @@ func newMatcher(automata Automata) matcher {
 		matcher.alreadyOn[state] = false
 	}
 
-	matcher.oldStates = append(matcher.oldStates, matcher.automata.initial)
-	matcher.move(empty)
+	matcher.oldThreads = append(matcher.oldThreads, thread{
+		state: matcher.automata.initial,
+		tags:  newGroupTags(automata.numGroups),
+	})
+	matcher.moveEmpty(0, true, atEnd)
 	return matcher
 }
 
-func (matcher *matcher) addState(state *state) {
-	matcher.newStates = append(matcher.newStates, state)
-	matcher.alreadyOn[state] = true
-	for _, nextState := range matcher.automata.getTransitions(state, empty) {
+// addState follows the epsilon, tag and anchor closure of th, appending every state it
+// reaches (including th itself) to newThreads. Threads are deduplicated by state, and
+// since threads are explored in the order their parents appear in oldThreads, the first
+// thread to reach a given state keeps it: earlier, i.e. leftmost, threads win ties.
+func (matcher *matcher) addState(th thread, pos int, atStart, atEnd bool) {
+	matcher.newThreads = append(matcher.newThreads, th)
+	matcher.alreadyOn[th.state] = true
+	for _, nextState := range matcher.automata.getTransitions(th.state, empty) {
 		if !matcher.alreadyOn[nextState] {
-			matcher.addState(nextState)
+			matcher.addState(thread{state: nextState, tags: th.tags}, pos, atStart, atEnd)
+		}
+	}
+	for _, tag := range matcher.automata.tags[th.state] {
+		if !matcher.alreadyOn[tag.target] {
+			matcher.addState(thread{state: tag.target, tags: th.tags.withTag(tag.group, tag.start, pos)}, pos, atStart, atEnd)
+		}
+	}
+	if atStart {
+		for _, nextState := range matcher.automata.startAnchors[th.state] {
+			if !matcher.alreadyOn[nextState] {
+				matcher.addState(thread{state: nextState, tags: th.tags}, pos, atStart, atEnd)
+			}
+		}
+	}
+	if atEnd {
+		for _, nextState := range matcher.automata.endAnchors[th.state] {
+			if !matcher.alreadyOn[nextState] {
+				matcher.addState(thread{state: nextState, tags: th.tags}, pos, atStart, atEnd)
+			}
 		}
 	}
 }
 
-func (matcher *matcher) move(c rune) {
-	for _, oldState := range matcher.oldStates {
-		for _, nextState := range matcher.automata.getTransitions(oldState, c) {
+// moveEmpty runs the epsilon/tag/anchor closure over the current old threads without
+// consuming a rune. It is used to seed the initial threads (atStart); move runs the
+// same closure through addState for the threads reached after consuming a rune.
+func (matcher *matcher) moveEmpty(pos int, atStart, atEnd bool) {
+	for _, oldThread := range matcher.oldThreads {
+		if !matcher.alreadyOn[oldThread.state] {
+			matcher.addState(oldThread, pos, atStart, atEnd)
+		}
+	}
+	matcher.transferStates()
+}
+
+func (matcher *matcher) move(c rune, pos int, atEnd bool) {
+	for _, oldThread := range matcher.oldThreads {
+		for _, nextState := range matcher.automata.getTransitions(oldThread.state, c) {
 			if !matcher.alreadyOn[nextState] {
-				matcher.addState(nextState)
+				matcher.addState(thread{state: nextState, tags: oldThread.tags}, pos, false, atEnd)
 			}
 		}
 	}
+	matcher.transferStates()
+}
 
-	// Transfer new states to old states.
-	matcher.oldStates = matcher.newStates
-	for _, newState := range matcher.newStates {
-		matcher.alreadyOn[newState] = false
+func (matcher *matcher) transferStates() {
+	// Transfer new threads to old threads.
+	matcher.oldThreads = matcher.newThreads
+	for _, newThread := range matcher.newThreads {
+		matcher.alreadyOn[newThread.state] = false
 	}
-	matcher.newStates = make([]*state, 0)
+	matcher.newThreads = make([]thread, 0)
 }
 
 func (matcher *matcher) isInAcceptingState() bool {
-	for _, cstate := range matcher.oldStates {
-		if matcher.automata.accepting == cstate {
+	for _, th := range matcher.oldThreads {
+		if matcher.automata.accepting == th.state {
 			return true
 		}
 	}
 	return false
 }
 
+// acceptingTags returns the group tags carried by the (leftmost-priority) thread that
+// reached the accepting state, or nil if no thread is currently accepting.
+func (matcher *matcher) acceptingTags() groupTags {
+	for _, th := range matcher.oldThreads {
+		if matcher.automata.accepting == th.state {
+			return th.tags
+		}
+	}
+	return nil
+}
+
 type expr interface {
 	convert() Automata
 }
 
+// newLeafAutomata builds the two-state, fully-initialised Automata used by every leaf
+// expr (match, class, anyChar, anchor, empty) so their maps are never nil.
+func newLeafAutomata(initial, accepting *state) Automata {
+	return Automata{
+		initial:   initial,
+		accepting: accepting,
+		transitions: map[*state]map[rune][]*state{
+			initial:   map[rune][]*state{},
+			accepting: map[rune][]*state{},
+		},
+		classes:      map[*state]classEdge{},
+		startAnchors: map[*state][]*state{},
+		endAnchors:   map[*state][]*state{},
+		tags:         map[*state][]tagEdge{},
+	}
+}
+
 // Match on a single character
 type match struct {
 	c rune
@@ -119,16 +420,59 @@ type match struct {
 func (match match) convert() Automata {
 	state0 := newState()
 	state1 := newState()
+	automata := newLeafAutomata(state0, state1)
+	automata.transitions[state0][match.c] = []*state{state1}
+	return automata
+}
+
+// Match on any single rune, i.e. the `.` metacharacter.
+type anyChar struct{}
+
+func (anyChar) convert() Automata {
+	state0 := newState()
+	state1 := newState()
+	automata := newLeafAutomata(state0, state1)
+	automata.classes[state0] = classEdge{set: &classSet{runes: map[rune]bool{}, negate: true}, target: state1}
+	return automata
+}
 
-	transitions := map[*state]map[rune][]*state{
-		state0: map[rune][]*state{match.c: []*state{state1}},
-		state1: map[rune][]*state{},
+// Match on a single rune accepted (or, if negated, rejected) by a character class,
+// e.g. [abc], [a-z] or [^abc].
+type class struct {
+	set *classSet
+}
+
+func (class class) convert() Automata {
+	state0 := newState()
+	state1 := newState()
+	automata := newLeafAutomata(state0, state1)
+	automata.classes[state0] = classEdge{set: class.set, target: state1}
+	return automata
+}
+
+// anchor matches the empty string, but only at the start (^) or end ($) of the input.
+type anchor struct {
+	start bool
+}
+
+func (anchor anchor) convert() Automata {
+	state0 := newState()
+	state1 := newState()
+	automata := newLeafAutomata(state0, state1)
+	if anchor.start {
+		automata.startAnchors[state0] = []*state{state1}
+	} else {
+		automata.endAnchors[state0] = []*state{state1}
 	}
+	return automata
+}
 
-	return Automata{
-		initial:     state0,
-		accepting:   state1,
-		transitions: transitions}
+// emptyMatch matches the empty string unconditionally. It underlies `?`.
+type emptyMatch struct{}
+
+func (emptyMatch) convert() Automata {
+	state0 := newState()
+	return newLeafAutomata(state0, state0)
 }
 
 // Match on concatenation of multiple expressions in order
@@ -151,8 +495,29 @@ func (concat concat) convert() Automata {
 
 func concatAutomata(a, b Automata) Automata {
 	a.transitions = mergeTransitions(a.transitions, b.transitions)
+	a.classes = mergeClasses(a.classes, b.classes)
+	a.startAnchors = mergeAnchors(a.startAnchors, b.startAnchors)
+	a.endAnchors = mergeAnchors(a.endAnchors, b.endAnchors)
+	a.tags = mergeTags(a.tags, b.tags)
+
 	a.transitions[a.accepting] = a.transitions[b.initial]
 	delete(a.transitions, b.initial)
+	if edge, hasClass := a.classes[b.initial]; hasClass {
+		a.classes[a.accepting] = edge
+		delete(a.classes, b.initial)
+	}
+	if targets, hasAnchor := a.startAnchors[b.initial]; hasAnchor {
+		a.startAnchors[a.accepting] = targets
+		delete(a.startAnchors, b.initial)
+	}
+	if targets, hasAnchor := a.endAnchors[b.initial]; hasAnchor {
+		a.endAnchors[a.accepting] = targets
+		delete(a.endAnchors, b.initial)
+	}
+	if edges, hasTag := a.tags[b.initial]; hasTag {
+		a.tags[a.accepting] = edges
+		delete(a.tags, b.initial)
+	}
 	a.accepting = b.accepting
 	return a
 }
@@ -170,6 +535,10 @@ func (union union) convert() Automata {
 	expr1Automata := union.expr1.convert()
 	expr2Automata := union.expr2.convert()
 	transitions := mergeTransitions(expr1Automata.transitions, expr2Automata.transitions)
+	classes := mergeClasses(expr1Automata.classes, expr2Automata.classes)
+	startAnchors := mergeAnchors(expr1Automata.startAnchors, expr2Automata.startAnchors)
+	endAnchors := mergeAnchors(expr1Automata.endAnchors, expr2Automata.endAnchors)
+	tags := mergeTags(expr1Automata.tags, expr2Automata.tags)
 	transitions[newInitial] = map[rune][]*state{
 		empty: []*state{expr1Automata.initial, expr2Automata.initial},
 	}
@@ -181,9 +550,14 @@ func (union union) convert() Automata {
 	}
 
 	return Automata{
-		initial:     newInitial,
-		accepting:   newAccepting,
-		transitions: transitions}
+		initial:      newInitial,
+		accepting:    newAccepting,
+		transitions:  transitions,
+		classes:      classes,
+		startAnchors: startAnchors,
+		endAnchors:   endAnchors,
+		tags:         tags,
+	}
 }
 
 func mergeTransitions(a, b map[*state]map[rune][]*state) map[*state]map[rune][]*state {
@@ -193,6 +567,27 @@ func mergeTransitions(a, b map[*state]map[rune][]*state) map[*state]map[rune][]*
 	return a
 }
 
+func mergeClasses(a, b map[*state]classEdge) map[*state]classEdge {
+	for state, edge := range b {
+		a[state] = edge
+	}
+	return a
+}
+
+func mergeAnchors(a, b map[*state][]*state) map[*state][]*state {
+	for state, targets := range b {
+		a[state] = targets
+	}
+	return a
+}
+
+func mergeTags(a, b map[*state][]tagEdge) map[*state][]tagEdge {
+	for state, edges := range b {
+		a[state] = edges
+	}
+	return a
+}
+
 // Match on 0 or more occurrences of one expression
 type kleene struct {
 	expr expr
@@ -206,15 +601,102 @@ func (kleene kleene) convert() Automata {
 	transitions[newInitial] = map[rune][]*state{
 		empty: []*state{subAutomata.initial, newAccepting},
 	}
+	transitions[subAutomata.accepting] = map[rune][]*state{
+		empty: []*state{subAutomata.initial, newAccepting},
+	}
+	transitions[newAccepting] = map[rune][]*state{}
+
+	return Automata{
+		initial:      newInitial,
+		accepting:    newAccepting,
+		transitions:  transitions,
+		classes:      subAutomata.classes,
+		startAnchors: subAutomata.startAnchors,
+		endAnchors:   subAutomata.endAnchors,
+		tags:         subAutomata.tags,
+	}
+}
+
+// lazyKleene matches 0 or more occurrences of one expression like kleene, but orders the
+// loop's epsilon transitions so that exiting the loop is preferred over re-entering it,
+// i.e. a non-greedy `*`. It isn't reachable from regex syntax; Find and friends use it to
+// build the implicit `.*?` search wrapper.
+type lazyKleene struct {
+	expr expr
+}
+
+func (lazyKleene lazyKleene) convert() Automata {
+	newInitial := newState()
+	newAccepting := newState()
+	subAutomata := lazyKleene.expr.convert()
+	transitions := subAutomata.transitions
+	transitions[newInitial] = map[rune][]*state{
+		empty: []*state{newAccepting, subAutomata.initial},
+	}
 	transitions[subAutomata.accepting] = map[rune][]*state{
 		empty: []*state{newAccepting, subAutomata.initial},
 	}
 	transitions[newAccepting] = map[rune][]*state{}
 
 	return Automata{
-		initial:     newInitial,
-		accepting:   newAccepting,
-		transitions: transitions}
+		initial:      newInitial,
+		accepting:    newAccepting,
+		transitions:  transitions,
+		classes:      subAutomata.classes,
+		startAnchors: subAutomata.startAnchors,
+		endAnchors:   subAutomata.endAnchors,
+		tags:         subAutomata.tags,
+	}
+}
+
+// Match on 1 or more occurrences of one expression, i.e. `xx*`.
+type plus struct {
+	expr expr
+}
+
+func (plus plus) convert() Automata {
+	return concat{exprs: []expr{plus.expr, kleene{expr: plus.expr}}}.convert()
+}
+
+// Match on 0 or 1 occurrences of one expression, i.e. a union with the empty string.
+type optional struct {
+	expr expr
+}
+
+func (optional optional) convert() Automata {
+	return union{expr1: emptyMatch{}, expr2: optional.expr}.convert()
+}
+
+// tagMark matches the empty string, but, when crossed during simulation, records the
+// input offset as the start or end boundary of a capturing group. It underlies group
+// and the implicit group 0 that Find and friends wrap around the whole expression.
+type tagMark struct {
+	group int
+	start bool
+}
+
+func (tagMark tagMark) convert() Automata {
+	state0 := newState()
+	state1 := newState()
+	automata := newLeafAutomata(state0, state1)
+	automata.tags[state0] = []tagEdge{{group: tagMark.group, start: tagMark.start, target: state1}}
+	return automata
+}
+
+// group wraps a subexpression in a numbered capturing group, so the simulation records
+// where it starts and ends. Group 0 is reserved for the whole match and is added
+// implicitly by Find and friends, not by the parser; parsed `(...)` groups start at 1.
+type group struct {
+	idx  int
+	expr expr
+}
+
+func (group group) convert() Automata {
+	return concat{exprs: []expr{
+		tagMark{group: group.idx, start: true},
+		group.expr,
+		tagMark{group: group.idx, start: false},
+	}}.convert()
 }
 
 // The `exprStack` is an order collection of expressions that are converted to a single expression.
@@ -241,18 +723,109 @@ func (stack *exprStack) modifyLastExpr(modifier func(e expr) expr) {
 	stack.push(modifier(stack.pop()))
 }
 
-func (stack exprStack) close() concat {
-	return concat{exprs: stack.exprs}
+// close turns the stack's accumulated expressions into a single concat, or fails with
+// ErrEmptyExpr if the stack is empty: a concat with no subexpressions has nothing to
+// match, and concat.convert panics rather than describe that as an automaton.
+func (stack exprStack) close() (concat, error) {
+	if len(stack.exprs) == 0 {
+		return concat{}, ErrEmptyExpr
+	}
+	return concat{exprs: stack.exprs}, nil
 }
 
-func (stack *exprStack) closeUnion() {
+func (stack *exprStack) closeUnion() error {
+	option, err := stack.close()
+	if err != nil {
+		return err
+	}
 	stack.exprs = []expr{
-		union{expr1: stack.unionOption, expr2: stack.close()},
+		union{expr1: stack.unionOption, expr2: option},
 	}
 	stack.unionOption = nil
+	return nil
+}
+
+// escapeMetacharacter reads the rune following a '\\' in a regular expression, allowing
+// any of the metacharacters *|()[]^$.+?\\ to be matched literally.
+func escapeMetacharacter(input *bufio.Reader) (rune, error) {
+	c, _, err := input.ReadRune()
+	if err != nil {
+		return 0, ErrExtraneousBackslash
+	}
+	return c, nil
+}
+
+// compileClass parses the body of a character class, e.g. `abc]` or `^a-z]`, having
+// already consumed the opening '['. It supports single runes, `a-z` ranges and a
+// leading `^` to negate the class.
+func compileClass(input *bufio.Reader) (*classSet, error) {
+	return compileClassBody(input, '^', escapeMetacharacter, ErrUnmatchedLbkt, ErrBadRange)
+}
+
+// compileClassBody parses the body of a character class shared by compileClass and
+// compileGlobClass, having already consumed the opening '['. negateRune is the rune that
+// negates the class when it leads the body ('^' for regex classes, '!' for glob classes);
+// escape reads the rune following a '\\'; errUnmatched and errBadRange are the errors to
+// report for an unclosed class and a malformed range respectively, so each caller can
+// report the error in its own syntax's terms.
+func compileClassBody(input *bufio.Reader, negateRune rune, escape func(*bufio.Reader) (rune, error), errUnmatched, errBadRange error) (*classSet, error) {
+	set := &classSet{runes: map[rune]bool{}}
+
+	c, _, err := input.ReadRune()
+	if err != nil {
+		return nil, errUnmatched
+	}
+	if c == negateRune {
+		set.negate = true
+		c, _, err = input.ReadRune()
+		if err != nil {
+			return nil, errUnmatched
+		}
+	}
+
+	for {
+		if c == ']' {
+			return set, nil
+		}
+		if c == '\\' {
+			if c, err = escape(input); err != nil {
+				return nil, err
+			}
+		}
+
+		next, _, nextErr := input.ReadRune()
+		if nextErr == nil && next == '-' {
+			hi, _, hiErr := input.ReadRune()
+			if hiErr != nil || hi == ']' || hi < c {
+				return nil, errBadRange
+			}
+			set.ranges = append(set.ranges, runeRange{lo: c, hi: hi})
+			c, _, err = input.ReadRune()
+			if err != nil {
+				return nil, errUnmatched
+			}
+			continue
+		}
+
+		set.runes[c] = true
+		if nextErr != nil {
+			return nil, errUnmatched
+		}
+		c = next
+	}
+}
+
+// compiler tracks parser state that must be threaded through the recursive-descent
+// parser below, namely the next unused capturing group number.
+type compiler struct {
+	nextGroup int
 }
 
-func compileExpression(input *bufio.Reader, isClosed func(rune, error) bool) (expr, error) {
+func newCompiler() *compiler {
+	return &compiler{nextGroup: 1}
+}
+
+func (comp *compiler) compileExpression(input *bufio.Reader, isClosed func(rune, error) bool) (expr, error) {
 	stack := exprStack{}
 	var (
 		c   rune
@@ -263,18 +836,55 @@ func compileExpression(input *bufio.Reader, isClosed func(rune, error) bool) (ex
 		switch c {
 		case '*':
 			if len(stack.exprs) == 0 {
-				return nil, errors.New("Invalid regular expression: expected expression before '*'")
+				return nil, ErrBareClosure
 			}
 			stack.modifyLastExpr(func(e expr) expr { return kleene{expr: e} })
 
+		case '+':
+			if len(stack.exprs) == 0 {
+				return nil, ErrBareClosure
+			}
+			stack.modifyLastExpr(func(e expr) expr { return plus{expr: e} })
+
+		case '?':
+			if len(stack.exprs) == 0 {
+				return nil, ErrBareClosure
+			}
+			stack.modifyLastExpr(func(e expr) expr { return optional{expr: e} })
+
+		case '.':
+			stack.push(anyChar{})
+
+		case '^':
+			stack.push(anchor{start: true})
+
+		case '$':
+			stack.push(anchor{start: false})
+
+		case '[':
+			set, err := compileClass(input)
+			if err != nil {
+				return nil, err
+			}
+			stack.push(class{set: set})
+
+		case '\\':
+			escaped, err := escapeMetacharacter(input)
+			if err != nil {
+				return nil, err
+			}
+			stack.push(match{c: escaped})
+
 		case '(':
-			expr, err := compileExpression(input, func(c rune, _ error) bool {
+			groupIdx := comp.nextGroup
+			comp.nextGroup++
+			inner, err := comp.compileExpression(input, func(c rune, _ error) bool {
 				return c == ')'
 			})
 			if err != nil {
 				return nil, err
 			}
-			stack.push(expr)
+			stack.push(group{idx: groupIdx, expr: inner})
 
 		// The union operator '|' operates, as the name suggests, as the union of 2 options.
 		// When found in a regular expression, it starts a new union expression with the current
@@ -282,11 +892,17 @@ func compileExpression(input *bufio.Reader, isClosed func(rune, error) bool) (ex
 		case '|':
 			// Close the previous union.
 			if stack.unionOption != nil {
-				stack.closeUnion()
+				if err := stack.closeUnion(); err != nil {
+					return nil, err
+				}
 			}
 
 			// Turn the current stack into the first union expression.
-			stack.unionOption = stack.close()
+			option, err := stack.close()
+			if err != nil {
+				return nil, err
+			}
+			stack.unionOption = option
 			stack.exprs = []expr{}
 
 		default:
@@ -298,25 +914,221 @@ func compileExpression(input *bufio.Reader, isClosed func(rune, error) bool) (ex
 	}
 
 	if stack.unionOption != nil {
-		stack.closeUnion()
+		if err := stack.closeUnion(); err != nil {
+			return nil, err
+		}
 	}
 
-	return stack.close(), nil
+	return stack.close()
 }
 
 // Compile takes a regular expression as an input stream and returns an Automata
 // as a result.
 func Compile(input *bufio.Reader) (*Automata, error) {
-	expr, err := compileExpression(input, func(_ rune, err error) bool {
+	comp := newCompiler()
+	parsed, err := comp.compileExpression(input, func(_ rune, err error) bool {
 		return err == io.EOF
 	})
 	if err != nil {
 		return nil, err
 	}
-	automata := expr.convert()
+	automata := parsed.convert()
+	automata.numGroups = comp.nextGroup - 1
 	return &automata, nil
 }
 
+// ErrNotDeterminizable is returned by Determinize when m uses anchors (`^`, `$`): they
+// only apply at the very start or end of the input, which a DFA transition table indexed
+// purely by the current state and the next rune cannot represent. Capturing groups are
+// fine: DFA.Matches doesn't report submatches, so Determinize simply treats a group's
+// tag edges as plain epsilon transitions and the group information is dropped.
+var ErrNotDeterminizable = errors.New("regex: automaton uses anchors, which a DFA can't represent")
+
+// DFA is a deterministic automaton produced by Automata.Determinize via subset
+// construction. Unlike the NFA simulation in matcher, which recomputes an epsilon
+// closure by recursion on every move, advancing through a DFA is a single slice lookup
+// by state index followed by a map lookup by rune, with no recursion or epsilon
+// closures at match time.
+type DFA struct {
+	start  int
+	accept map[int]bool
+	trans  []map[rune]int
+}
+
+// Matches reports whether in, read start to finish, drives the DFA from its start state
+// to an accepting one.
+func (d *DFA) Matches(in string) bool {
+	st := d.start
+	for _, c := range in {
+		next, ok := d.trans[st][c]
+		if !ok {
+			return false
+		}
+		st = next
+	}
+	return d.accept[st]
+}
+
+// MatchesBytes is Matches' fast path for byte-oriented input: the same walk, decoding one
+// UTF-8 rune at a time instead of building a []rune up front, so it allocates nothing and
+// never falls back to the NFA's recursive simulation. Indexing by raw byte value would
+// silently mismatch any multi-byte rune, since trans is keyed by rune, not byte.
+func (d *DFA) MatchesBytes(in []byte) bool {
+	st := d.start
+	for len(in) > 0 {
+		c, size := utf8.DecodeRune(in)
+		next, ok := d.trans[st][c]
+		if !ok {
+			return false
+		}
+		st = next
+		in = in[size:]
+	}
+	return d.accept[st]
+}
+
+// alphabet returns the set of runes Determinize must compute transitions for. It is the
+// literal runes that appear as explicit transition keys anywhere in m, widened to every
+// byte value 0-255 when m also contains a character class (`.`, `[...]`): classes match
+// by predicate rather than by explicit rune, so without this widening a DFA built from m
+// would have no transition for a rune a class should accept. Runes above U+00FF are
+// consequently not matched through a class by the DFA path. When m.foldCase is set, each
+// literal rune is also widened to its case variants, since getTransitions tries those
+// same variants during NFA simulation; without this, the DFA would only ever gain a
+// transition keyed by whichever case the pattern was written in.
+func (m Automata) alphabet() []rune {
+	seen := make(map[rune]bool)
+	for _, edges := range m.transitions {
+		for c := range edges {
+			if c != empty {
+				seen[c] = true
+			}
+		}
+	}
+	if m.foldCase {
+		literal := make([]rune, 0, len(seen))
+		for c := range seen {
+			literal = append(literal, c)
+		}
+		for _, c := range literal {
+			for _, v := range caseVariants(c) {
+				seen[v] = true
+			}
+		}
+	}
+	if len(m.classes) > 0 {
+		for b := rune(0); b < 256; b++ {
+			seen[b] = true
+		}
+	}
+
+	runes := make([]rune, 0, len(seen))
+	for c := range seen {
+		runes = append(runes, c)
+	}
+	return runes
+}
+
+// nfaStateSetKey builds a canonical, comparable key for a set of NFA states, so that
+// subset construction can recognise when two different paths through the NFA reach the
+// same set of states and should collapse onto the same DFA state. It sorts each state's
+// pointer, printed as an integer the same way printAutomata numbers states, since *state
+// values have no other stable ordering.
+func nfaStateSetKey(states []*state) string {
+	nums := make([]int, len(states))
+	for i, st := range states {
+		nums[i] = int(uintptr(unsafe.Pointer(st)))
+	}
+	sort.Ints(nums)
+
+	parts := make([]string, len(nums))
+	for i, n := range nums {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ",")
+}
+
+// Determinize performs classical subset construction on m, producing an equivalent DFA
+// whose states are epsilon-closures of sets of NFA states. It fails with
+// ErrNotDeterminizable if m has anchors, since a DFA has no way to represent
+// start/end-of-input. Capturing groups' tag edges are followed as plain epsilon
+// transitions, so grouped expressions still determinize; the resulting DFA just can't
+// report where a group matched.
+func (m Automata) Determinize() (*DFA, error) {
+	if len(m.startAnchors) > 0 || len(m.endAnchors) > 0 {
+		return nil, ErrNotDeterminizable
+	}
+
+	closure := func(states []*state) []*state {
+		seen := make(map[*state]bool)
+		stack := append([]*state{}, states...)
+		var result []*state
+		for len(stack) > 0 {
+			st := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if seen[st] {
+				continue
+			}
+			seen[st] = true
+			result = append(result, st)
+			if next, ok := m.transitions[st][empty]; ok {
+				stack = append(stack, next...)
+			}
+			for _, tag := range m.tags[st] {
+				stack = append(stack, tag.target)
+			}
+		}
+		return result
+	}
+
+	dfaIndex := make(map[string]int)
+	var nfaSets [][]*state
+	var trans []map[rune]int
+	accept := make(map[int]bool)
+
+	addState := func(states []*state) (idx int, isNew bool) {
+		key := nfaStateSetKey(states)
+		if idx, ok := dfaIndex[key]; ok {
+			return idx, false
+		}
+		idx = len(nfaSets)
+		dfaIndex[key] = idx
+		nfaSets = append(nfaSets, states)
+		trans = append(trans, make(map[rune]int))
+		for _, st := range states {
+			if st == m.accepting {
+				accept[idx] = true
+			}
+		}
+		return idx, true
+	}
+
+	alphabet := m.alphabet()
+	start, _ := addState(closure([]*state{m.initial}))
+	queue := []int{start}
+	for len(queue) > 0 {
+		idx := queue[0]
+		queue = queue[1:]
+
+		for _, c := range alphabet {
+			var targets []*state
+			for _, st := range nfaSets[idx] {
+				targets = append(targets, m.getTransitions(st, c)...)
+			}
+			if len(targets) == 0 {
+				continue
+			}
+			nextIdx, isNew := addState(closure(targets))
+			trans[idx][c] = nextIdx
+			if isNew {
+				queue = append(queue, nextIdx)
+			}
+		}
+	}
+
+	return &DFA{start: start, accept: accept, trans: trans}, nil
+}
+
 func printAutomata(automata *Automata) {
 	numToStateMap := make(map[int]*state)
 	for state, transitions := range automata.transitions {
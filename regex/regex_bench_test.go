@@ -0,0 +1,42 @@
+package regex
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+// BenchmarkDeterminize compares the recursive NFA simulation against the DFA produced by
+// Determinize on a pathological pattern: `(a|a)*b` gives the NFA simulation two
+// equivalent threads to carry through every 'a', so every rune of a long run of a's
+// costs Matches a recursive epsilon closure over both branches. The DFA collapses those
+// threads into one state ahead of time, so each rune costs a single table lookup.
+func BenchmarkDeterminize(b *testing.B) {
+	automata, err := Compile(bufio.NewReader(strings.NewReader("(a|a)*b")))
+	if err != nil {
+		b.Fatal(err)
+	}
+	dfa, err := automata.Determinize()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	input := strings.Repeat("a", 2000) + "b"
+	inputBytes := []byte(input)
+
+	b.Run("NFA", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			automata.Matches(input)
+		}
+	})
+	b.Run("DFA", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			dfa.Matches(input)
+		}
+	})
+	b.Run("DFA/MatchesBytes", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			dfa.MatchesBytes(inputBytes)
+		}
+	})
+}
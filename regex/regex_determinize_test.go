@@ -0,0 +1,52 @@
+package regex
+
+import (
+	"testing"
+)
+
+// TestDeterminize checks that a DFA built by Determinize agrees with the NFA it was built
+// from, including character classes, case folding, and non-ASCII literals via both
+// Matches and the byte-oriented MatchesBytes fast path.
+func TestDeterminize(t *testing.T) {
+	cases := []struct {
+		pattern    string
+		ignoreCase bool
+		in         string
+		want       bool
+	}{
+		{"abc", false, "abc", true},
+		{"abc", false, "abd", false},
+		{"[a-z]+", false, "hello", true},
+		{"[a-z]+", false, "HELLO", false},
+		{"ABC", true, "abc", true},
+		{"ABC", true, "AbC", true},
+		{"ABC", true, "abd", false},
+		{"café", false, "café", true},
+		{"café", false, "cafe", false},
+	}
+	for _, c := range cases {
+		automata := compile(t, c.pattern)
+		if c.ignoreCase {
+			automata.IgnoreCase()
+		}
+		dfa, err := automata.Determinize()
+		if err != nil {
+			t.Fatalf("Determinize(%q): %v", c.pattern, err)
+		}
+		if got := dfa.Matches(c.in); got != c.want {
+			t.Errorf("Determinize(%q).Matches(%q) = %v, want %v", c.pattern, c.in, got, c.want)
+		}
+		if got := dfa.MatchesBytes([]byte(c.in)); got != c.want {
+			t.Errorf("Determinize(%q).MatchesBytes(%q) = %v, want %v", c.pattern, c.in, got, c.want)
+		}
+	}
+}
+
+// TestDeterminizeAnchors checks that a pattern using '^' or '$' is rejected with
+// ErrNotDeterminizable rather than silently producing a DFA that ignores the anchor.
+func TestDeterminizeAnchors(t *testing.T) {
+	automata := compile(t, "^abc$")
+	if _, err := automata.Determinize(); err != ErrNotDeterminizable {
+		t.Errorf("Determinize(%q) err = %v, want %v", "^abc$", err, ErrNotDeterminizable)
+	}
+}
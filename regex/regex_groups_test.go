@@ -0,0 +1,75 @@
+package regex
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+// TestFindSubmatch checks capturing groups and the thread-priority rules that decide a
+// greedy quantifier's submatch boundaries: (a*) must capture the longest run of a's, not
+// stop short because some other thread reached the accepting state first.
+func TestFindSubmatch(t *testing.T) {
+	cases := []struct {
+		pattern string
+		in      string
+		want    []string
+	}{
+		{"(a)(b)", "ab", []string{"ab", "a", "b"}},
+		{"(a*)b", "aaab", []string{"aaab", "aaa"}},
+		{"(a+)(b+)", "aabb", []string{"aabb", "aa", "bb"}},
+		{"a(b)?c", "ac", []string{"ac", ""}},
+	}
+	for _, c := range cases {
+		automata := compile(t, c.pattern)
+		got := automata.FindSubmatch(c.in)
+		if len(got) != len(c.want) {
+			t.Fatalf("Compile(%q).FindSubmatch(%q) = %v, want %v", c.pattern, c.in, got, c.want)
+		}
+		for i := range c.want {
+			if got[i] != c.want[i] {
+				t.Errorf("Compile(%q).FindSubmatch(%q)[%d] = %q, want %q", c.pattern, c.in, i, got[i], c.want[i])
+			}
+		}
+	}
+}
+
+// TestEmptyGroup checks that a capturing group with nothing in it, e.g. "a()b", is
+// reported as ErrEmptyExpr rather than panicking: group.convert reduces to
+// concat.convert, which panics on an empty concat, and capturing groups make an
+// empty one far more likely to show up in practice than with chunk0-1's bare unions alone.
+func TestEmptyGroup(t *testing.T) {
+	_, err := Compile(bufio.NewReader(strings.NewReader("a()b")))
+	if err != ErrEmptyExpr {
+		t.Errorf("Compile(%q) err = %v, want %v", "a()b", err, ErrEmptyExpr)
+	}
+}
+
+// TestFind checks leftmost, unanchored matching.
+func TestFind(t *testing.T) {
+	automata := compile(t, "b+")
+	start, end, ok := automata.Find("aabbbcc")
+	if !ok || start != 2 || end != 5 {
+		t.Errorf("Find(aabbbcc) = %d, %d, %v, want 2, 5, true", start, end, ok)
+	}
+	if _, _, ok := automata.Find("aaacc"); ok {
+		t.Error("expected no match")
+	}
+}
+
+// TestFindAll checks that successive non-overlapping matches, including zero-length
+// matches, advance correctly: "a*" against "baab" matches the empty string before each
+// 'b' in addition to the run of a's, mirroring e.g. Python's re.findall(r'a*', 'baab').
+func TestFindAll(t *testing.T) {
+	automata := compile(t, "a*")
+	spans := automata.FindAll("baab")
+	want := [][2]int{{0, 0}, {1, 3}, {3, 3}, {4, 4}}
+	if len(spans) != len(want) {
+		t.Fatalf("FindAll(baab) = %v, want %v", spans, want)
+	}
+	for i := range want {
+		if spans[i] != want[i] {
+			t.Errorf("FindAll(baab)[%d] = %v, want %v", i, spans[i], want[i])
+		}
+	}
+}
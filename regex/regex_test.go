@@ -0,0 +1,82 @@
+package regex
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func compile(t *testing.T, pattern string) *Automata {
+	t.Helper()
+	automata, err := Compile(bufio.NewReader(strings.NewReader(pattern)))
+	if err != nil {
+		t.Fatalf("Compile(%q): %v", pattern, err)
+	}
+	return automata
+}
+
+// TestMatchesSyntax exercises the syntax chunk0-1 added on top of the baseline engine:
+// anchors, character classes, `.`, `+`, `?` and backslash escapes.
+func TestMatchesSyntax(t *testing.T) {
+	cases := []struct {
+		pattern string
+		in      string
+		want    bool
+	}{
+		{"^abc$", "abc", true},
+		{"^abc$", "xabc", false},
+		{"^abc$", "abcx", false},
+		{"a.c", "abc", true},
+		{"a.c", "ac", false},
+		{"[abc]", "b", true},
+		{"[abc]", "d", false},
+		{"[a-z]", "m", true},
+		{"[a-z]", "M", false},
+		{"[^abc]", "d", true},
+		{"[^abc]", "a", false},
+		{"ab+c", "ac", false},
+		{"ab+c", "abc", true},
+		{"ab+c", "abbbc", true},
+		{"ab?c", "ac", true},
+		{"ab?c", "abc", true},
+		{"ab?c", "abbc", false},
+		{`a\.c`, "a.c", true},
+		{`a\.c`, "abc", false},
+		{`a\*c`, "a*c", true},
+	}
+	for _, c := range cases {
+		automata := compile(t, c.pattern)
+		if got := automata.Matches(c.in); got != c.want {
+			t.Errorf("Compile(%q).Matches(%q) = %v, want %v", c.pattern, c.in, got, c.want)
+		}
+	}
+}
+
+// TestCompileErrors checks that malformed syntax is reported as a returned error rather
+// than a panic, including the empty-expression cases (a bare '|', an empty group, an
+// empty alternation branch) that previously reached concat.convert's panic.
+func TestCompileErrors(t *testing.T) {
+	cases := []struct {
+		pattern string
+		wantErr error
+	}{
+		{"[abc", ErrUnmatchedLbkt},
+		{"[z-a]", ErrBadRange},
+		{"*a", ErrBareClosure},
+		{"+a", ErrBareClosure},
+		{"?a", ErrBareClosure},
+		{`a\`, ErrExtraneousBackslash},
+		{"", ErrEmptyExpr},
+		{"|a", ErrEmptyExpr},
+		{"a|", ErrEmptyExpr},
+		{"a||b", ErrEmptyExpr},
+		{"()", ErrEmptyExpr},
+		{"a(b|)c", ErrEmptyExpr},
+	}
+	for _, c := range cases {
+		_, err := Compile(bufio.NewReader(strings.NewReader(c.pattern)))
+		if err != c.wantErr {
+			t.Errorf("Compile(%q) err = %v, want %v", c.pattern, err, c.wantErr)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package regex
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Errors returned by CompileSubex when the subex syntax is invalid.
+var (
+	// ErrSubexBareQuantifier is returned when '*' or '-' appears with nothing preceding
+	// it to repeat.
+	ErrSubexBareQuantifier = errors.New("regex: subex quantifier has nothing to repeat")
+	// ErrSubexUnmatchedSlot is returned when a `$name(` is never closed by a matching
+	// ')', or `$` is not followed by a valid slot name and '('.
+	ErrSubexUnmatchedSlot = errors.New("regex: subex unmatched '(' in named slot")
+	// ErrSubexMissingOutput is returned when the matcher expression isn't followed by a
+	// `"..."` output template.
+	ErrSubexMissingOutput = errors.New(`regex: subex missing "..." output template`)
+	// ErrSubexUnterminatedOutput is returned when the `"..."` output template is never
+	// closed.
+	ErrSubexUnterminatedOutput = errors.New("regex: subex unterminated output template")
+)
+
+// Replace returns a copy of in with every non-overlapping match of m replaced by
+// template, which may reference the match and its capturing groups as $0, $1, ...; $0 is
+// the whole match, as returned by FindSubmatch.
+func (m Automata) Replace(in, template string) string {
+	runes := []rune(in)
+	var out strings.Builder
+	offset := 0
+	for offset <= len(runes) {
+		spans := m.findSubmatches(string(runes[offset:]))
+		if spans == nil {
+			break
+		}
+		start, end := spans[0], spans[1]
+		out.WriteString(string(runes[offset : offset+start]))
+		out.WriteString(expandGroupTemplate(template, runes[offset:], spans))
+		offset += end
+		if end == start {
+			if offset < len(runes) {
+				out.WriteRune(runes[offset])
+			}
+			offset++
+		}
+	}
+	if offset < len(runes) {
+		out.WriteString(string(runes[offset:]))
+	}
+	return out.String()
+}
+
+// expandGroupTemplate expands the $0, $1, ... references in template against base, the
+// runes the match was found in, using the group boundaries recorded in spans.
+func expandGroupTemplate(template string, base []rune, spans groupTags) string {
+	var out strings.Builder
+	runes := []rune(template)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '$' || i+1 >= len(runes) || runes[i+1] < '0' || runes[i+1] > '9' {
+			out.WriteRune(runes[i])
+			continue
+		}
+		j := i + 1
+		for j < len(runes) && runes[j] >= '0' && runes[j] <= '9' {
+			j++
+		}
+		group, _ := strconv.Atoi(string(runes[i+1 : j]))
+		if 2*group+1 < len(spans) {
+			start, end := spans[2*group], spans[2*group+1]
+			if start >= 0 && end >= 0 {
+				out.WriteString(string(base[start:end]))
+			}
+		}
+		i = j - 1
+	}
+	return out.String()
+}
+
+// Substituter pairs a compiled subex matcher automaton with the output template it
+// feeds: Run finds the matcher's leftmost match in the input, then expands the template
+// by substituting each $name with the text the matcher captured into that named slot.
+// It is produced by CompileSubex.
+type Substituter struct {
+	matcher  *Automata
+	slots    map[string]int
+	template string
+}
+
+// isSlotNameRune reports whether c can appear in a `$name` slot reference, either in a
+// subex program's `$name(...)` capture or in its `"..."` output template.
+func isSlotNameRune(c rune) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// subexCompiler tracks parser state threaded through the recursive-descent subex
+// parser below: the next unused slot index, and the index assigned to each slot name.
+type subexCompiler struct {
+	nextSlot int
+	slots    map[string]int
+}
+
+func newSubexCompiler() *subexCompiler {
+	return &subexCompiler{nextSlot: 1, slots: map[string]int{}}
+}
+
+func (comp *subexCompiler) readSlotName(input *bufio.Reader) (string, error) {
+	var name []rune
+	for {
+		r, _, err := input.ReadRune()
+		if err != nil {
+			return "", ErrSubexUnmatchedSlot
+		}
+		if !isSlotNameRune(r) {
+			input.UnreadRune()
+			break
+		}
+		name = append(name, r)
+	}
+	if len(name) == 0 {
+		return "", ErrSubexUnmatchedSlot
+	}
+	return string(name), nil
+}
+
+// compileMatcher parses the matcher half of a subex program: concatenation, `|`
+// alternation, postfix `*` (greedy) and `-` (lazy) repetition, literal runes, `.` for any
+// rune, and `$name(...)` named captures. It stops, without consuming, at whatever rune
+// isClosed reports true for (the subex grammar uses this both for the `"` that starts
+// the output template and the `)` that closes a named slot), or at EOF.
+//
+// It reuses the expr tree that Compile builds (match, anyChar, concat, union, kleene,
+// lazyKleene, group) to build the matcher: a subex program and a regular expression
+// describe the same kind of automaton, just with named rather than numbered captures.
+func (comp *subexCompiler) compileMatcher(input *bufio.Reader, isClosed func(rune, error) bool) (expr, error) {
+	stack := exprStack{}
+	var (
+		r   rune
+		err error
+	)
+
+	for r, _, err = input.ReadRune(); !isClosed(r, err) && err == nil; r, _, err = input.ReadRune() {
+		switch r {
+		case '*':
+			if len(stack.exprs) == 0 {
+				return nil, ErrSubexBareQuantifier
+			}
+			stack.modifyLastExpr(func(e expr) expr { return kleene{expr: e} })
+
+		case '-':
+			if len(stack.exprs) == 0 {
+				return nil, ErrSubexBareQuantifier
+			}
+			stack.modifyLastExpr(func(e expr) expr { return lazyKleene{expr: e} })
+
+		case '.':
+			stack.push(anyChar{})
+
+		case '$':
+			name, err := comp.readSlotName(input)
+			if err != nil {
+				return nil, err
+			}
+			open, _, err := input.ReadRune()
+			if err != nil || open != '(' {
+				return nil, ErrSubexUnmatchedSlot
+			}
+			inner, err := comp.compileMatcher(input, func(r rune, _ error) bool {
+				return r == ')'
+			})
+			if err == io.EOF {
+				return nil, ErrSubexUnmatchedSlot
+			}
+			if err != nil {
+				return nil, err
+			}
+			idx := comp.nextSlot
+			comp.nextSlot++
+			comp.slots[name] = idx
+			stack.push(group{idx: idx, expr: inner})
+
+		// '|' behaves exactly as it does in the main regex grammar: see compileExpression.
+		case '|':
+			if stack.unionOption != nil {
+				if err := stack.closeUnion(); err != nil {
+					return nil, err
+				}
+			}
+			option, err := stack.close()
+			if err != nil {
+				return nil, err
+			}
+			stack.unionOption = option
+			stack.exprs = []expr{}
+
+		default:
+			stack.push(match{c: r})
+		}
+	}
+	if !isClosed(r, err) && err != nil {
+		return nil, err
+	}
+
+	if stack.unionOption != nil {
+		if err := stack.closeUnion(); err != nil {
+			return nil, err
+		}
+	}
+	return stack.close()
+}
+
+// CompileSubex parses a subex program -- a matcher expression followed by a quoted
+// output template -- and returns a Substituter that runs the matcher against input and
+// expands the template from what it captured, e.g.:
+//
+//	$first(.-) $rest(.*)"$rest $first"
+//
+// matches a leading run of non-space runes up to the first space (the lazy `.-` stops as
+// soon as the following literal ' ' can match) followed by everything else, and swaps
+// the two in its output.
+func CompileSubex(input *bufio.Reader) (*Substituter, error) {
+	comp := newSubexCompiler()
+	sawQuote := false
+	parsed, err := comp.compileMatcher(input, func(r rune, err error) bool {
+		sawQuote = r == '"'
+		return sawQuote || err == io.EOF
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !sawQuote {
+		return nil, ErrSubexMissingOutput
+	}
+
+	var template []rune
+	for {
+		r, _, err := input.ReadRune()
+		if err != nil {
+			return nil, ErrSubexUnterminatedOutput
+		}
+		if r == '"' {
+			break
+		}
+		template = append(template, r)
+	}
+
+	automata := parsed.convert()
+	automata.numGroups = comp.nextSlot - 1
+	return &Substituter{matcher: &automata, slots: comp.slots, template: string(template)}, nil
+}
+
+// Run finds s's matcher pattern as the leftmost match in in and returns its output
+// template with each $name expanded to the text captured by that named slot, or an
+// error if the pattern does not match anywhere in in.
+func (s *Substituter) Run(in string) (string, error) {
+	spans := s.matcher.findSubmatches(in)
+	if spans == nil {
+		return "", fmt.Errorf("regex: subex pattern did not match %q", in)
+	}
+
+	runes := []rune(in)
+	template := []rune(s.template)
+	var out strings.Builder
+	for i := 0; i < len(template); i++ {
+		if template[i] != '$' {
+			out.WriteRune(template[i])
+			continue
+		}
+		j := i + 1
+		for j < len(template) && isSlotNameRune(template[j]) {
+			j++
+		}
+		name := string(template[i+1 : j])
+		idx, isSlot := s.slots[name]
+		if !isSlot {
+			out.WriteRune(template[i])
+			continue
+		}
+		start, end := spans[2*idx], spans[2*idx+1]
+		if start >= 0 && end >= 0 {
+			out.WriteString(string(runes[start:end]))
+		}
+		i = j - 1
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,85 @@
+package regex
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func compileSubex(t *testing.T, program string) *Substituter {
+	t.Helper()
+	s, err := CompileSubex(bufio.NewReader(strings.NewReader(program)))
+	if err != nil {
+		t.Fatalf("CompileSubex(%q): %v", program, err)
+	}
+	return s
+}
+
+// TestSubexRun checks that named slots are captured and substituted into the output
+// template, including the lazy `-` quantifier stopping as soon as the rest of the pattern
+// can match rather than consuming greedily.
+func TestSubexRun(t *testing.T) {
+	s := compileSubex(t, `$first(.-) $rest(.*)"$rest $first"`)
+	got, err := s.Run("hello world and more")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "world and more hello"
+	if got != want {
+		t.Errorf("Run = %q, want %q", got, want)
+	}
+}
+
+// TestSubexRunNoMatch checks that Run reports an error, rather than an empty
+// substitution, when the matcher pattern doesn't match anywhere in the input.
+func TestSubexRunNoMatch(t *testing.T) {
+	s := compileSubex(t, `$word(a+)"$word"`)
+	if _, err := s.Run("xyz"); err == nil {
+		t.Error("expected an error for no match")
+	}
+}
+
+// TestCompileSubexErrors checks that malformed subex programs are reported as returned
+// errors: a bare quantifier, an unclosed named slot, and a missing output template.
+func TestCompileSubexErrors(t *testing.T) {
+	cases := []struct {
+		program string
+		wantErr error
+	}{
+		{`*a"$a"`, ErrSubexBareQuantifier},
+		{`-a"$a"`, ErrSubexBareQuantifier},
+		{`$a(bc"$a"`, ErrSubexUnmatchedSlot},
+		{`$a(bc)`, ErrSubexMissingOutput},
+		{`$a(bc)"$a`, ErrSubexUnterminatedOutput},
+	}
+	for _, c := range cases {
+		_, err := CompileSubex(bufio.NewReader(strings.NewReader(c.program)))
+		if err != c.wantErr {
+			t.Errorf("CompileSubex(%q) err = %v, want %v", c.program, err, c.wantErr)
+		}
+	}
+}
+
+// TestReplace checks non-overlapping substitution, including a greedy-kleene capture
+// group: (a+)(b+) must capture each run in full, the same priority rule
+// TestFindSubmatch checks, not stop short on the first thread to reach an accepting
+// state.
+func TestReplace(t *testing.T) {
+	automata := compile(t, "(a+)(b+)")
+	got := automata.Replace("xx aabb yy aabbb zz", "[$1-$2]")
+	want := "xx [aa-bb] yy [aa-bbb] zz"
+	if got != want {
+		t.Errorf("Replace = %q, want %q", got, want)
+	}
+}
+
+// TestReplaceZeroLengthMatch checks that Replace advances past a zero-length match
+// instead of looping forever.
+func TestReplaceZeroLengthMatch(t *testing.T) {
+	automata := compile(t, "a*")
+	got := automata.Replace("baab", "-")
+	want := "-b--b-"
+	if got != want {
+		t.Errorf("Replace = %q, want %q", got, want)
+	}
+}